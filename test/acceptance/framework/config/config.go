@@ -0,0 +1,56 @@
+// Package config holds the TestConfig struct shared across acceptance
+// tests: everything about the environment that isn't specific to a single
+// Kubernetes context, such as where to write debug output or which install
+// path to exercise.
+package config
+
+import "fmt"
+
+// TestConfig holds configuration for the test suite.
+type TestConfig struct {
+	KubeconfigPath string
+	KubeContext    string
+	Namespace      string
+
+	// NoCleanupOnFailure, if true, will skip cleanup of resources left over
+	// after a test fails so they can be inspected.
+	NoCleanupOnFailure bool
+
+	// DebugDirectory is the directory where test debug information is
+	// written, e.g. pod logs gathered on failure.
+	DebugDirectory string
+
+	// UseCLI, if true, installs Consul via the consul-k8s CLI instead of
+	// via `helm install`.
+	UseCLI bool
+
+	EnableEnterprise  bool
+	EnterpriseLicense string
+
+	ConsulImage    string
+	ConsulK8SImage string
+}
+
+// HelmValuesFromConfig returns the Helm values that should be set on every
+// installation based on the flags the test suite was run with, e.g. the
+// images to use and the enterprise license.
+func (t *TestConfig) HelmValuesFromConfig() (map[string]string, error) {
+	helmValues := map[string]string{}
+
+	if t.EnableEnterprise {
+		if t.EnterpriseLicense == "" {
+			return nil, fmt.Errorf("-enable-enterprise provided without -enterprise-license")
+		}
+		helmValues["server.enterpriseLicense.secretName"] = "license"
+		helmValues["server.enterpriseLicense.secretKey"] = "key"
+	}
+
+	if t.ConsulImage != "" {
+		helmValues["global.image"] = t.ConsulImage
+	}
+	if t.ConsulK8SImage != "" {
+		helmValues["global.imageK8S"] = t.ConsulK8SImage
+	}
+
+	return helmValues, nil
+}
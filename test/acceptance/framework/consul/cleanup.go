@@ -0,0 +1,234 @@
+package consul
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterScopedResources are the cluster-scoped resource types the Consul
+// Helm chart can create and that Destroy cleans up by default, in addition
+// to the namespaced Secrets/ServiceAccounts it has always cleaned up. Not
+// every cluster has every one of these APIs registered (SCCs only exist on
+// OpenShift, for example), so lookups against them tolerate "no such API"
+// errors.
+var clusterScopedResources = []schema.GroupVersionResource{
+	{Group: "policy", Version: "v1beta1", Resource: "podsecuritypolicies"},
+	{Group: "security.openshift.io", Version: "v1", Resource: "securitycontextconstraints"},
+	{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "validatingwebhookconfigurations"},
+	{Group: "admissionregistration.k8s.io", Version: "v1", Resource: "mutatingwebhookconfigurations"},
+}
+
+// crdResource is the CRDs the Consul Helm chart can create. Unlike the
+// resources in clusterScopedResources, CRDs are typically shared by every
+// Consul release in a cluster rather than created one per release: deleting
+// one cascades to delete every CR instance of that kind cluster-wide, which
+// would take out other releases/tests still running. So Destroy only
+// touches these when a test has explicitly opted in via WithCRDCleanup,
+// e.g. because it knows its release is the last/only one in the cluster.
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// CleanupPolicy decides which of a release's namespaced and cluster-scoped
+// resources Destroy deletes.
+type CleanupPolicy interface {
+	// labelSelector, if non-empty, is used to narrow the List call Destroy
+	// makes for each resource type before matches is consulted.
+	labelSelector() string
+	// matches reports whether the named resource should be deleted.
+	matches(name string) bool
+}
+
+// LabelCleanupPolicy deletes only resources labeled both
+// "release=<releaseName>" and "app=consul", namespaced and cluster-scoped
+// alike. This is the default: it
+// only ever touches resources the chart itself labeled, so it's safe to use
+// even when multiple releases share a namespace or a release name collides
+// with an unrelated resource's name.
+func LabelCleanupPolicy(releaseName string) CleanupPolicy {
+	return &labelCleanupPolicy{releaseName: releaseName}
+}
+
+type labelCleanupPolicy struct {
+	releaseName string
+}
+
+func (p *labelCleanupPolicy) labelSelector() string {
+	return "release=" + p.releaseName + ",app=consul"
+}
+
+func (p *labelCleanupPolicy) matches(string) bool {
+	// The label selector above has already done the filtering.
+	return true
+}
+
+// NameCleanupPolicy restores the old, more aggressive behavior: any resource
+// whose name merely contains releaseName is deleted. It's useful against
+// older chart versions or hand-created resources that predate consistent
+// release/app labeling, but unsafe when release names can collide with
+// unrelated resources (e.g. release "consul" matching "consul-foo").
+func NameCleanupPolicy(releaseName string) CleanupPolicy {
+	return &nameCleanupPolicy{releaseName: releaseName}
+}
+
+type nameCleanupPolicy struct {
+	releaseName string
+}
+
+func (p *nameCleanupPolicy) labelSelector() string { return "" }
+
+func (p *nameCleanupPolicy) matches(name string) bool {
+	return strings.Contains(name, p.releaseName)
+}
+
+// CustomCleanupPolicy deletes any resource for which predicate returns true.
+func CustomCleanupPolicy(predicate func(name string) bool) CleanupPolicy {
+	return &customCleanupPolicy{predicate: predicate}
+}
+
+type customCleanupPolicy struct {
+	predicate func(name string) bool
+}
+
+func (p *customCleanupPolicy) labelSelector() string { return "" }
+
+func (p *customCleanupPolicy) matches(name string) bool {
+	return p.predicate(name)
+}
+
+// WithCleanupPolicy overrides the CleanupPolicy Destroy uses, which
+// defaults to LabelCleanupPolicy. It returns h so it can be chained.
+// NewHelmCluster/NewCluster return the Cluster interface, which doesn't
+// declare this method, so callers need a type assertion first, e.g.
+// NewHelmCluster(...).(*HelmCluster).WithCleanupPolicy(...).
+func (h *HelmCluster) WithCleanupPolicy(policy CleanupPolicy) *HelmCluster {
+	h.cleanupPolicy = policy
+	return h
+}
+
+// WithCRDCleanup opts h into deleting CRDs matching its CleanupPolicy on
+// Destroy, in addition to the cluster-scoped resources cleaned up by
+// default. This is unsafe unless the caller knows no other release in the
+// cluster depends on the same CRDs, since deleting one cascades to every CR
+// instance of that kind cluster-wide. It returns h so it can be chained.
+// NewHelmCluster/NewCluster return the Cluster interface, which doesn't
+// declare this method, so callers need a type assertion first, e.g.
+// NewHelmCluster(...).(*HelmCluster).WithCRDCleanup().
+func (h *HelmCluster) WithCRDCleanup() *HelmCluster {
+	h.cleanupCRDs = true
+	return h
+}
+
+// cleanupNamespacedResources deletes ServiceAccounts and Secrets in the
+// release's namespace that match h.cleanupPolicy.
+func (h *HelmCluster) cleanupNamespacedResources(t *testing.T) {
+	t.Helper()
+
+	namespace := h.helmOptions.KubectlOptions.Namespace
+	listOpts := metav1.ListOptions{}
+	if sel := h.cleanupPolicy.labelSelector(); sel != "" {
+		listOpts.LabelSelector = sel
+	}
+
+	sas, err := h.kubernetesClient.CoreV1().ServiceAccounts(namespace).List(context.TODO(), listOpts)
+	require.NoError(t, err)
+	for _, sa := range sas.Items {
+		if !h.cleanupPolicy.matches(sa.Name) {
+			continue
+		}
+		err := h.kubernetesClient.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), sa.Name, metav1.DeleteOptions{})
+		if !errors.IsNotFound(err) {
+			require.NoError(t, err)
+		}
+	}
+
+	secrets, err := h.kubernetesClient.CoreV1().Secrets(namespace).List(context.TODO(), listOpts)
+	require.NoError(t, err)
+	for _, secret := range secrets.Items {
+		if !h.cleanupPolicy.matches(secret.Name) {
+			continue
+		}
+		err := h.kubernetesClient.CoreV1().Secrets(namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+		if !errors.IsNotFound(err) {
+			require.NoError(t, err)
+		}
+	}
+}
+
+// cleanupClusterScopedResources deletes the PodSecurityPolicies, SCCs, and
+// webhook configurations (see clusterScopedResources) that match
+// h.cleanupPolicy, plus CRDs if h.cleanupCRDs was opted into via
+// WithCRDCleanup. These aren't namespaced, so they otherwise leak between
+// runs of the same release name.
+func (h *HelmCluster) cleanupClusterScopedResources(t *testing.T) {
+	t.Helper()
+
+	if h.dynamicClient == nil {
+		return
+	}
+
+	listOpts := metav1.ListOptions{}
+	if sel := h.cleanupPolicy.labelSelector(); sel != "" {
+		listOpts.LabelSelector = sel
+	}
+
+	for _, gvr := range clusterScopedResources {
+		h.cleanupResource(t, gvr, listOpts)
+	}
+	if h.cleanupCRDs {
+		h.cleanupResource(t, crdResource, listOpts)
+	}
+}
+
+// cleanupResource deletes every instance of gvr matching both listOpts and
+// h.cleanupPolicy.
+func (h *HelmCluster) cleanupResource(t *testing.T, gvr schema.GroupVersionResource, listOpts metav1.ListOptions) {
+	t.Helper()
+
+	list, err := h.dynamicClient.Resource(gvr).List(context.TODO(), listOpts)
+	if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		// The API isn't registered on this cluster (e.g. SCCs on non-OpenShift).
+		return
+	}
+	require.NoError(t, err)
+
+	for _, item := range list.Items {
+		if !h.cleanupPolicy.matches(item.GetName()) {
+			continue
+		}
+		err := h.dynamicClient.Resource(gvr).Delete(context.TODO(), item.GetName(), metav1.DeleteOptions{})
+		if !errors.IsNotFound(err) {
+			require.NoError(t, err)
+		}
+	}
+}
+
+// newDynamicClient builds a dynamic client for the cluster/context the
+// given KubectlOptions points at, for deleting the cluster-scoped resource
+// types above without needing a typed clientset for each one.
+func newDynamicClient(t *testing.T, kubectlOptions *k8s.KubectlOptions) dynamic.Interface {
+	t.Helper()
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubectlOptions.ConfigPath != "" {
+		loadingRules.ExplicitPath = kubectlOptions.ConfigPath
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubectlOptions.ContextName},
+	).ClientConfig()
+	require.NoError(t, err)
+
+	client, err := dynamic.NewForConfig(restConfig)
+	require.NoError(t, err)
+	return client
+}
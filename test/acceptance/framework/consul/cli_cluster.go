@@ -0,0 +1,180 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	testlogger "github.com/hashicorp/consul-helm/test/acceptance/framework/logger"
+	"github.com/hashicorp/consul-helm/test/acceptance/helpers"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/freeport"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// CLICluster implements Cluster and uses the consul-k8s CLI to create,
+// destroy, and upgrade Consul, rather than calling out to Helm directly.
+// It merges helm values the same way HelmCluster does so that the same
+// acceptance test can be run against either install path.
+type CLICluster struct {
+	ctx                environment.TestContext
+	helmOptions        *helm.Options
+	releaseName        string
+	kubernetesClient   kubernetes.Interface
+	noCleanupOnFailure bool
+	debugDirectory     string
+}
+
+func NewCLICluster(
+	t *testing.T,
+	helmValues map[string]string,
+	ctx environment.TestContext,
+	cfg *config.TestConfig,
+	releaseName string) Cluster {
+
+	// Deploy single-server cluster by default unless helmValues overwrites that
+	values := map[string]string{
+		"server.replicas":        "1",
+		"server.bootstrapExpect": "1",
+	}
+	valuesFromConfig, err := cfg.HelmValuesFromConfig()
+	require.NoError(t, err)
+
+	// Merge all helm values
+	helpers.MergeMaps(values, valuesFromConfig)
+	helpers.MergeMaps(values, helmValues)
+
+	opts := &helm.Options{
+		SetValues:      values,
+		KubectlOptions: ctx.KubectlOptions(t),
+		Logger:         testlogger.New(cfg.DebugDirectory),
+	}
+
+	return &CLICluster{
+		ctx:                ctx,
+		helmOptions:        opts,
+		releaseName:        releaseName,
+		kubernetesClient:   ctx.KubernetesClient(t),
+		noCleanupOnFailure: cfg.NoCleanupOnFailure,
+		debugDirectory:     cfg.DebugDirectory,
+	}
+}
+
+func (c *CLICluster) Create(t *testing.T) {
+	t.Helper()
+
+	helpers.Cleanup(t, c.noCleanupOnFailure, func() {
+		c.Destroy(t)
+	})
+
+	// Fail if there are any existing installations of the Helm chart.
+	helpers.CheckForPriorInstallations(t, c.helmOptions)
+
+	c.runConsulK8s(t, "install", "-auto-approve", "-name", c.releaseName)
+
+	helpers.WaitForAllPodsToBeReady(t, c.kubernetesClient, c.helmOptions.KubectlOptions.Namespace, fmt.Sprintf("release=%s", c.releaseName))
+}
+
+func (c *CLICluster) Destroy(t *testing.T) {
+	t.Helper()
+
+	helpers.WritePodsDebugInfoIfFailed(t, c.helmOptions.KubectlOptions, c.debugDirectory, "release="+c.releaseName)
+
+	c.runConsulK8s(t, "uninstall", "-auto-approve", "-name", c.releaseName, "-wipe-data")
+
+	// delete PVCs
+	c.kubernetesClient.CoreV1().PersistentVolumeClaims(c.helmOptions.KubectlOptions.Namespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "release=" + c.releaseName})
+}
+
+func (c *CLICluster) Upgrade(t *testing.T, helmValues map[string]string) {
+	t.Helper()
+
+	helpers.MergeMaps(c.helmOptions.SetValues, helmValues)
+	c.runConsulK8s(t, "upgrade", "-auto-approve", "-name", c.releaseName)
+	helpers.WaitForAllPodsToBeReady(t, c.kubernetesClient, c.helmOptions.KubectlOptions.Namespace, fmt.Sprintf("release=%s", c.releaseName))
+}
+
+func (c *CLICluster) SetupConsulClient(t *testing.T, secure bool, opts ...ConsulClientOption) *api.Client {
+	t.Helper()
+
+	options := consulClientOptions{serverPod: fmt.Sprintf("%s-consul-server-0", c.releaseName)}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	namespace := c.helmOptions.KubectlOptions.Namespace
+	clientConfig := api.DefaultConfig()
+	localPort := freeport.MustTake(1)[0]
+	remotePort := 8500 // use non-secure by default
+
+	if secure {
+		remotePort = 8501
+		clientConfig.TLSConfig.InsecureSkipVerify = true
+		clientConfig.Scheme = "https"
+
+		aclSecret, err := c.kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), c.releaseName+"-consul-bootstrap-acl-token", metav1.GetOptions{})
+		if err != nil && errors.IsNotFound(err) {
+			federationSecret := fmt.Sprintf("%s-consul-federation", c.releaseName)
+			aclSecret, err = c.kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), federationSecret, metav1.GetOptions{})
+			require.NoError(t, err)
+			clientConfig.Token = string(aclSecret.Data["replicationToken"])
+		} else if err == nil {
+			clientConfig.Token = string(aclSecret.Data["token"])
+		} else {
+			require.NoError(t, err)
+		}
+	}
+
+	tunnel := k8s.NewTunnel(c.helmOptions.KubectlOptions, k8s.ResourceTypePod, options.serverPod, localPort, remotePort)
+	tunnel.ForwardPort(t)
+
+	t.Cleanup(func() {
+		tunnel.Close()
+	})
+
+	clientConfig.Address = fmt.Sprintf("127.0.0.1:%d", localPort)
+	consulClient, err := api.NewClient(clientConfig)
+	require.NoError(t, err)
+
+	return consulClient
+}
+
+// runConsulK8s shells out to the consul-k8s CLI binary, passing along the
+// current kubeconfig/namespace and the merged Helm values as -set flags so
+// that the resulting installation is equivalent to one produced by
+// HelmCluster.
+func (c *CLICluster) runConsulK8s(t *testing.T, subcommand string, extraArgs ...string) {
+	t.Helper()
+
+	args := []string{subcommand}
+	args = append(args, extraArgs...)
+	args = append(args, "-namespace", c.helmOptions.KubectlOptions.Namespace)
+
+	if kubeconfig := c.helmOptions.KubectlOptions.ConfigPath; kubeconfig != "" {
+		args = append(args, "-kubeconfig", kubeconfig)
+	}
+	if kubeContext := c.helmOptions.KubectlOptions.ContextName; kubeContext != "" {
+		args = append(args, "-context", kubeContext)
+	}
+
+	for k, v := range c.helmOptions.SetValues {
+		args = append(args, "-set", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	cmd := shell.Command{
+		Command: "consul-k8s",
+		Args:    args,
+		Logger:  testlogger.New(c.debugDirectory),
+	}
+	err := shell.RunCommandE(t, cmd)
+	require.NoError(t, err, "consul-k8s %s failed: %s", subcommand, strings.Join(args, " "))
+}
@@ -0,0 +1,247 @@
+// Package consul provides the Cluster abstraction (and its HelmCluster,
+// CLICluster and VaultCluster implementations) that acceptance tests use to
+// create, destroy and upgrade Consul installations.
+package consul
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	testlogger "github.com/hashicorp/consul-helm/test/acceptance/framework/logger"
+	"github.com/hashicorp/consul-helm/test/acceptance/helpers"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/freeport"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The path to the helm chart.
+// Note: this will need to be changed if this file is moved.
+const helmChartPath = "../../../.."
+
+// Cluster represents a consul cluster object
+type Cluster interface {
+	Create(t *testing.T)
+	Destroy(t *testing.T)
+	// Upgrade upgrades the installation (HelmCluster runs helm upgrade,
+	// CLICluster runs consul-k8s upgrade). It will merge the helm values from the
+	// initial install with helmValues. Any keys that were previously set
+	// will be overridden by the helmValues keys.
+	Upgrade(t *testing.T, helmValues map[string]string)
+	// SetupConsulClient returns a client configured to talk to this
+	// cluster's own server-0 pod by default. Pass WithServerPod to target a
+	// different server pod, e.g. when verifying WAN federation from a
+	// different datacenter's perspective.
+	SetupConsulClient(t *testing.T, secure bool, opts ...ConsulClientOption) *api.Client
+}
+
+// ConsulClientOption customizes the client returned by SetupConsulClient.
+type ConsulClientOption func(*consulClientOptions)
+
+type consulClientOptions struct {
+	serverPod string
+}
+
+// WithServerPod overrides the pod SetupConsulClient opens a tunnel to,
+// instead of the cluster's own `<releaseName>-consul-server-0`. This is
+// used by federated/multi-datacenter tests that need to talk to a specific
+// datacenter's server from a cluster wired up to several of them.
+func WithServerPod(podName string) ConsulClientOption {
+	return func(o *consulClientOptions) {
+		o.serverPod = podName
+	}
+}
+
+// NewCluster returns a Cluster backed by either HelmCluster or CLICluster,
+// depending on cfg.UseCLI. This lets the same acceptance test suite exercise
+// both the `helm install` and `consul-k8s install` code paths.
+func NewCluster(
+	t *testing.T,
+	helmValues map[string]string,
+	ctx environment.TestContext,
+	cfg *config.TestConfig,
+	releaseName string) Cluster {
+
+	if cfg.UseCLI {
+		return NewCLICluster(t, helmValues, ctx, cfg, releaseName)
+	}
+	return NewHelmCluster(t, helmValues, ctx, cfg, releaseName)
+}
+
+// HelmCluster implements Cluster and uses Helm
+// to create, destroy, and upgrade consul
+type HelmCluster struct {
+	ctx                environment.TestContext
+	helmOptions        *helm.Options
+	releaseName        string
+	kubernetesClient   kubernetes.Interface
+	noCleanupOnFailure bool
+	debugDirectory     string
+	vaultCluster       *VaultCluster
+	cleanupPolicy      CleanupPolicy
+	cleanupCRDs        bool
+	dynamicClient      dynamic.Interface
+	partition          string
+}
+
+func NewHelmCluster(
+	t *testing.T,
+	helmValues map[string]string,
+	ctx environment.TestContext,
+	cfg *config.TestConfig,
+	releaseName string) Cluster {
+
+	// Deploy single-server cluster by default unless helmValues overwrites that
+	values := map[string]string{
+		"server.replicas":        "1",
+		"server.bootstrapExpect": "1",
+	}
+	valuesFromConfig, err := cfg.HelmValuesFromConfig()
+	require.NoError(t, err)
+
+	// Merge all helm values
+	helpers.MergeMaps(values, valuesFromConfig)
+	helpers.MergeMaps(values, helmValues)
+
+	opts := &helm.Options{
+		SetValues:      values,
+		KubectlOptions: ctx.KubectlOptions(t),
+		Logger:         testlogger.New(cfg.DebugDirectory),
+	}
+	return &HelmCluster{
+		ctx:                ctx,
+		helmOptions:        opts,
+		releaseName:        releaseName,
+		kubernetesClient:   ctx.KubernetesClient(t),
+		noCleanupOnFailure: cfg.NoCleanupOnFailure,
+		debugDirectory:     cfg.DebugDirectory,
+		cleanupPolicy:      LabelCleanupPolicy(releaseName),
+		dynamicClient:      newDynamicClient(t, opts.KubectlOptions),
+	}
+}
+
+func (h *HelmCluster) Create(t *testing.T) {
+	t.Helper()
+
+	// Make sure we delete the cluster if we receive an interrupt signal and
+	// register cleanup so that we delete the cluster when test finishes.
+	helpers.Cleanup(t, h.noCleanupOnFailure, func() {
+		h.Destroy(t)
+	})
+
+	// Fail if there are any existing installations of the Helm chart.
+	helpers.CheckForPriorInstallations(t, h.helmOptions)
+
+	err := helm.InstallE(t, h.helmOptions, helmChartPath, h.releaseName)
+	require.NoError(t, err)
+
+	helpers.WaitForAllPodsToBeReady(t, h.kubernetesClient, h.helmOptions.KubectlOptions.Namespace, fmt.Sprintf("release=%s", h.releaseName))
+}
+
+func (h *HelmCluster) Destroy(t *testing.T) {
+	t.Helper()
+
+	helpers.WritePodsDebugInfoIfFailed(t, h.helmOptions.KubectlOptions, h.debugDirectory, "release="+h.releaseName)
+
+	helm.Delete(t, h.helmOptions, h.releaseName, false)
+
+	// delete PVCs
+	h.kubernetesClient.CoreV1().PersistentVolumeClaims(h.helmOptions.KubectlOptions.Namespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "release=" + h.releaseName})
+
+	h.cleanupNamespacedResources(t)
+	h.cleanupClusterScopedResources(t)
+}
+
+func (h *HelmCluster) Upgrade(t *testing.T, helmValues map[string]string) {
+	t.Helper()
+
+	helpers.MergeMaps(h.helmOptions.SetValues, helmValues)
+	helm.Upgrade(t, h.helmOptions, helmChartPath, h.releaseName)
+	helpers.WaitForAllPodsToBeReady(t, h.kubernetesClient, h.helmOptions.KubectlOptions.Namespace, fmt.Sprintf("release=%s", h.releaseName))
+}
+
+func (h *HelmCluster) SetupConsulClient(t *testing.T, secure bool, opts ...ConsulClientOption) *api.Client {
+	t.Helper()
+
+	options := consulClientOptions{serverPod: fmt.Sprintf("%s-consul-server-0", h.releaseName)}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	namespace := h.helmOptions.KubectlOptions.Namespace
+	clientConfig := api.DefaultConfig()
+	localPort := freeport.MustTake(1)[0]
+	remotePort := 8500 // use non-secure by default
+
+	if secure {
+		// Overwrite remote port to HTTPS.
+		remotePort = 8501
+
+		// It's OK to skip TLS verification for local traffic.
+		clientConfig.TLSConfig.InsecureSkipVerify = true
+		clientConfig.Scheme = "https"
+
+		if h.partition != "" {
+			// This is a client-only installation joined to another cluster's
+			// servers in a non-default partition (see NewHelmClusterInPartition),
+			// so it has its own partition-scoped ACL token rather than a
+			// bootstrap token.
+			clientConfig.Partition = h.partition
+			aclSecret, err := h.kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), h.releaseName+"-consul-partitions-acl-token", metav1.GetOptions{})
+			require.NoError(t, err)
+			clientConfig.Token = string(aclSecret.Data["token"])
+		} else if h.helmOptions.SetValues["global.secretsBackend.vault.enabled"] == "true" {
+			// The bootstrap/replication ACL token lives in Vault rather than
+			// in a Kubernetes Secret when the Vault secrets backend is enabled.
+			require.NotNil(t, h.vaultCluster, "HelmCluster.vaultCluster must be set via UseVaultSecretsBackend when global.secretsBackend.vault.enabled is true")
+			clientConfig.Token = h.vaultCluster.BootstrapToken(t)
+		} else {
+			// Get the ACL token. First, attempt to read it from the bootstrap token (this will be true in primary Consul servers).
+			// If the bootstrap token doesn't exist, it means we are running against a secondary cluster
+			// and will try to read the replication token from the federation secret.
+			// In secondary servers, we don't create a bootstrap token since ACLs are only bootstrapped in the primary.
+			// Instead, we provide a replication token that serves the role of the bootstrap token.
+			aclSecret, err := h.kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), h.releaseName+"-consul-bootstrap-acl-token", metav1.GetOptions{})
+			if err != nil && errors.IsNotFound(err) {
+				federationSecret := fmt.Sprintf("%s-consul-federation", h.releaseName)
+				aclSecret, err = h.kubernetesClient.CoreV1().Secrets(namespace).Get(context.TODO(), federationSecret, metav1.GetOptions{})
+				require.NoError(t, err)
+				clientConfig.Token = string(aclSecret.Data["replicationToken"])
+			} else if err == nil {
+				clientConfig.Token = string(aclSecret.Data["token"])
+			} else {
+				require.NoError(t, err)
+			}
+		}
+	}
+
+	tunnel := k8s.NewTunnel(h.helmOptions.KubectlOptions, k8s.ResourceTypePod, options.serverPod, localPort, remotePort)
+	tunnel.ForwardPort(t)
+
+	t.Cleanup(func() {
+		tunnel.Close()
+	})
+
+	clientConfig.Address = fmt.Sprintf("127.0.0.1:%d", localPort)
+	consulClient, err := api.NewClient(clientConfig)
+	require.NoError(t, err)
+
+	return consulClient
+}
+
+// UseVaultSecretsBackend points h at an already-created VaultCluster and
+// merges in the `global.secretsBackend.vault.*` Helm values it exposes, so
+// that subsequent calls to Create/Upgrade/SetupConsulClient source Consul's
+// secrets from Vault instead of Kubernetes Secrets.
+func (h *HelmCluster) UseVaultSecretsBackend(vault *VaultCluster) {
+	h.vaultCluster = vault
+	helpers.MergeMaps(h.helmOptions.SetValues, vault.HelmValues())
+}
@@ -0,0 +1,60 @@
+package consul
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CopyCACertAndKey copies the CA cert and CA key secrets generated by the
+// primary cluster's installation into the namespace of a secondary
+// TestContext under the secondary release's secret names. This must be done
+// before installing Consul into the secondary cluster so that both
+// datacenters trust the same CA when federating over the mesh gateway.
+func CopyCACertAndKey(t *testing.T, primary *HelmCluster, secondaryCtx environment.TestContext, secondaryReleaseName string) {
+	t.Helper()
+
+	copySecret(t, primary, secondaryCtx, primary.releaseName+"-consul-ca-cert", secondaryReleaseName+"-consul-ca-cert")
+	copySecret(t, primary, secondaryCtx, primary.releaseName+"-consul-ca-key", secondaryReleaseName+"-consul-ca-key")
+}
+
+// ApplyFederationSecret copies the `<release>-consul-federation` secret
+// generated by the primary cluster's installation (it contains the gossip
+// key, replication token and mesh gateway addresses needed to join the WAN)
+// into the namespace of a secondary TestContext so the secondary datacenter
+// can federate with the primary.
+func ApplyFederationSecret(t *testing.T, primary *HelmCluster, secondaryCtx environment.TestContext, secondaryReleaseName string) {
+	t.Helper()
+
+	copySecret(t, primary, secondaryCtx, primary.releaseName+"-consul-federation", secondaryReleaseName+"-consul-federation")
+}
+
+// copySecret reads a secret out of the primary cluster's namespace and
+// creates (or updates, if it already exists) a secret with the same data
+// under destName in secondaryCtx's namespace.
+func copySecret(t *testing.T, primary *HelmCluster, secondaryCtx environment.TestContext, srcName, destName string) {
+	t.Helper()
+
+	primaryNamespace := primary.helmOptions.KubectlOptions.Namespace
+	secret, err := primary.kubernetesClient.CoreV1().Secrets(primaryNamespace).Get(context.TODO(), srcName, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	secondaryNamespace := secondaryCtx.KubectlOptions(t).Namespace
+	secondaryClient := secondaryCtx.KubernetesClient(t)
+
+	newSecret := secret.DeepCopy()
+	newSecret.ObjectMeta = metav1.ObjectMeta{
+		Name:      destName,
+		Namespace: secondaryNamespace,
+	}
+
+	_, err = secondaryClient.CoreV1().Secrets(secondaryNamespace).Create(context.TODO(), newSecret, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		_, err = secondaryClient.CoreV1().Secrets(secondaryNamespace).Update(context.TODO(), newSecret, metav1.UpdateOptions{})
+	}
+	require.NoError(t, err)
+}
@@ -0,0 +1,79 @@
+package consul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	"github.com/hashicorp/consul-helm/test/acceptance/helpers"
+)
+
+// NewHelmClusterInPartition returns a HelmCluster configured as a
+// client-only installation in the non-default admin partition
+// partitionName, joined to server's servers via externalServers rather than
+// running its own. Callers must still call CopyPartitionSecrets to give it
+// the CA and ACL token material server's cluster created before calling
+// Create.
+//
+// server and the returned client cluster are expected to share a network
+// (e.g. the same underlying Kubernetes cluster, or one with routable pod/
+// service IPs between them) so that the in-cluster DNS name this
+// constructs is actually reachable; if they don't, override
+// "externalServers.hosts[0]" in helmValues with a reachable address (for
+// example a LoadBalancer IP in front of server's Consul servers) instead.
+//
+// Because this release has server.enabled=false, it has no
+// "<releaseName>-consul-server-0" pod, so SetupConsulClient's default
+// serverPod doesn't exist here. Callers must pass consul.WithServerPod
+// naming one of this release's own client pods (its client agents are a
+// DaemonSet, so there's no static pod name to default to) or one of
+// server's server pods, depending on which agent they want to talk to.
+func NewHelmClusterInPartition(
+	t *testing.T,
+	helmValues map[string]string,
+	ctx environment.TestContext,
+	cfg *config.TestConfig,
+	releaseName string,
+	partitionName string,
+	server *HelmCluster) Cluster {
+
+	serverNamespace := server.helmOptions.KubectlOptions.Namespace
+	serverHost := fmt.Sprintf("%s-consul-server.%s.svc.cluster.local", server.releaseName, serverNamespace)
+
+	partitionValues := map[string]string{
+		"global.adminPartitions.enabled":    "true",
+		"global.adminPartitions.name":       partitionName,
+		"global.enabled":                    "false",
+		"server.enabled":                    "false",
+		"client.enabled":                    "true",
+		"externalServers.enabled":           "true",
+		"externalServers.hosts[0]":          serverHost,
+		"externalServers.httpsPort":         "8501",
+		"externalServers.k8sAuthMethodHost": serverHost,
+	}
+	helpers.MergeMaps(partitionValues, helmValues)
+
+	cluster := NewHelmCluster(t, partitionValues, ctx, cfg, releaseName)
+	cluster.(*HelmCluster).partition = partitionName
+	return cluster
+}
+
+// CopyPartitionSecrets copies the CA cert/key and the bootstrap and
+// partitions ACL tokens generated by a server cluster's installation into
+// the namespace of a client-only partition cluster, under that cluster's
+// own release name. This must be done before calling Create on the
+// client-only cluster returned by NewHelmClusterInPartition, since its
+// client agents need to trust the same CA and authenticate with the
+// servers' ACL system to join the partition.
+//
+// Remember that SetupConsulClient on that client-only cluster needs an
+// explicit consul.WithServerPod — see the warning on NewHelmClusterInPartition.
+func CopyPartitionSecrets(t *testing.T, server *HelmCluster, clientCtx environment.TestContext, clientReleaseName string) {
+	t.Helper()
+
+	copySecret(t, server, clientCtx, server.releaseName+"-consul-ca-cert", clientReleaseName+"-consul-ca-cert")
+	copySecret(t, server, clientCtx, server.releaseName+"-consul-ca-key", clientReleaseName+"-consul-ca-key")
+	copySecret(t, server, clientCtx, server.releaseName+"-consul-bootstrap-acl-token", clientReleaseName+"-consul-bootstrap-acl-token")
+	copySecret(t, server, clientCtx, server.releaseName+"-consul-partitions-acl-token", clientReleaseName+"-consul-partitions-acl-token")
+}
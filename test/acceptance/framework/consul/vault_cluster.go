@@ -0,0 +1,280 @@
+package consul
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	testlogger "github.com/hashicorp/consul-helm/test/acceptance/framework/logger"
+	"github.com/hashicorp/consul-helm/test/acceptance/helpers"
+	"github.com/hashicorp/consul/sdk/freeport"
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// vaultHelmChartPath is the Helm chart repo/name used to install Vault into
+// the test cluster. Tests are expected to have already run `helm repo add
+// hashicorp https://helm.releases.hashicorp.com`.
+const vaultHelmChartPath = "hashicorp/vault"
+
+// VaultCluster installs a single-node, dev-mode Vault cluster and configures
+// it as a Consul secrets backend: it generates the server TLS CA (in "pki")
+// and Connect CA (in "connect-ca"), writes the gossip encryption key and
+// bootstrap/replication ACL tokens, writes the enterprise license when one
+// was configured, and sets up the Kubernetes auth method so Consul
+// server/client pods can authenticate to it.
+type VaultCluster struct {
+	ctx                environment.TestContext
+	helmOptions        *helm.Options
+	releaseName        string
+	vaultReleaseName   string
+	kubernetesClient   kubernetes.Interface
+	vaultClient        *vaultapi.Client
+	noCleanupOnFailure bool
+	debugDirectory     string
+	enableEnterprise   bool
+	enterpriseLicense  string
+}
+
+// NewVaultCluster creates a VaultCluster that will be installed alongside
+// the Consul release named releaseName.
+func NewVaultCluster(
+	t *testing.T,
+	ctx environment.TestContext,
+	cfg *config.TestConfig,
+	releaseName string) *VaultCluster {
+
+	vaultReleaseName := releaseName + "-vault"
+
+	values := map[string]string{
+		"server.dev.enabled": "true",
+	}
+
+	opts := &helm.Options{
+		SetValues:      values,
+		KubectlOptions: ctx.KubectlOptions(t),
+		Logger:         testlogger.New(cfg.DebugDirectory),
+	}
+
+	return &VaultCluster{
+		ctx:                ctx,
+		helmOptions:        opts,
+		releaseName:        releaseName,
+		vaultReleaseName:   vaultReleaseName,
+		kubernetesClient:   ctx.KubernetesClient(t),
+		noCleanupOnFailure: cfg.NoCleanupOnFailure,
+		debugDirectory:     cfg.DebugDirectory,
+		enableEnterprise:   cfg.EnableEnterprise,
+		enterpriseLicense:  cfg.EnterpriseLicense,
+	}
+}
+
+// Create installs the Vault Helm chart, waits for it to be ready, and
+// configures it as a Consul secrets backend: the Kubernetes auth method,
+// the KV/PKI secrets engines, and the secrets themselves.
+func (v *VaultCluster) Create(t *testing.T) {
+	t.Helper()
+
+	helpers.Cleanup(t, v.noCleanupOnFailure, func() {
+		v.Destroy(t)
+	})
+
+	err := helm.InstallE(t, v.helmOptions, vaultHelmChartPath, v.vaultReleaseName)
+	require.NoError(t, err)
+
+	helpers.WaitForAllPodsToBeReady(t, v.kubernetesClient, v.helmOptions.KubectlOptions.Namespace, fmt.Sprintf("app.kubernetes.io/instance=%s", v.vaultReleaseName))
+
+	v.vaultClient = v.setupVaultClient(t)
+
+	v.configureKubernetesAuthMethod(t)
+	v.writeConsulSecrets(t)
+}
+
+func (v *VaultCluster) Destroy(t *testing.T) {
+	t.Helper()
+
+	helpers.WritePodsDebugInfoIfFailed(t, v.helmOptions.KubectlOptions, v.debugDirectory, "app.kubernetes.io/instance="+v.vaultReleaseName)
+
+	helm.Delete(t, v.helmOptions, v.vaultReleaseName, false)
+
+	v.kubernetesClient.CoreV1().PersistentVolumeClaims(v.helmOptions.KubectlOptions.Namespace).DeleteCollection(context.TODO(), metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: "app.kubernetes.io/instance=" + v.vaultReleaseName})
+}
+
+// setupVaultClient forwards a local port to the Vault server pod and returns
+// a Vault API client configured to talk to it, authenticated as the dev
+// mode root token.
+func (v *VaultCluster) setupVaultClient(t *testing.T) *vaultapi.Client {
+	t.Helper()
+
+	localPort := freeport.MustTake(1)[0]
+	tunnel := k8s.NewTunnel(v.helmOptions.KubectlOptions, k8s.ResourceTypePod, fmt.Sprintf("%s-0", v.vaultReleaseName), localPort, 8200)
+	tunnel.ForwardPort(t)
+	t.Cleanup(func() {
+		tunnel.Close()
+	})
+
+	vaultConfig := vaultapi.DefaultConfig()
+	vaultConfig.Address = fmt.Sprintf("http://127.0.0.1:%d", localPort)
+
+	client, err := vaultapi.NewClient(vaultConfig)
+	require.NoError(t, err)
+	client.SetToken("root")
+
+	return client
+}
+
+// configureKubernetesAuthMethod enables and configures the kubernetes auth
+// method so that Consul server/client service accounts can log in to Vault.
+func (v *VaultCluster) configureKubernetesAuthMethod(t *testing.T) {
+	t.Helper()
+
+	err := v.vaultClient.Sys().EnableAuthWithOptions("kubernetes", &vaultapi.EnableAuthOptions{Type: "kubernetes"})
+	require.NoError(t, err)
+
+	namespace := v.helmOptions.KubectlOptions.Namespace
+	_, err = v.vaultClient.Logical().Write("auth/kubernetes/config", map[string]interface{}{
+		"kubernetes_host": "https://kubernetes.default.svc",
+	})
+	require.NoError(t, err)
+
+	policy := fmt.Sprintf(`
+path "secret/data/%s/*" {
+  capabilities = ["read"]
+}
+path "pki/*" {
+  capabilities = ["read", "create", "update"]
+}
+path "connect-ca/*" {
+  capabilities = ["read", "create", "update"]
+}
+path "connect-ca-intermediate/*" {
+  capabilities = ["read", "create", "update"]
+}`, v.releaseName)
+	err = v.vaultClient.Sys().PutPolicy(v.releaseName, policy)
+	require.NoError(t, err)
+
+	_, err = v.vaultClient.Logical().Write(fmt.Sprintf("auth/kubernetes/role/%s", v.releaseName), map[string]interface{}{
+		"bound_service_account_names":      []string{fmt.Sprintf("%s-consul-server", v.releaseName), fmt.Sprintf("%s-consul-client", v.releaseName)},
+		"bound_service_account_namespaces": []string{namespace},
+		"policies":                         []string{v.releaseName},
+		"ttl":                              "24h",
+	})
+	require.NoError(t, err)
+}
+
+// writeConsulSecrets writes the gossip encryption key and bootstrap/
+// replication ACL tokens to Vault's KV engine, generates the server TLS CA
+// (in "pki") and Connect CA (in "connect-ca") that the Consul chart issues
+// certificates from, mounts an empty "connect-ca-intermediate" for Consul
+// to populate itself, and, if an enterprise license was configured, writes
+// that too.
+func (v *VaultCluster) writeConsulSecrets(t *testing.T) {
+	t.Helper()
+
+	secretPath := fmt.Sprintf("secret/data/%s", v.releaseName)
+
+	_, err := v.vaultClient.Logical().Write(secretPath+"/gossip", map[string]interface{}{
+		"data": map[string]interface{}{"key": "OWVkNDk1ZjY4NzVhZTQ1NzkzOGZjMzEwOGNlYjQ3NDE="},
+	})
+	require.NoError(t, err)
+
+	_, err = v.vaultClient.Logical().Write(secretPath+"/bootstrap-token", map[string]interface{}{
+		"data": map[string]interface{}{"token": "root"},
+	})
+	require.NoError(t, err)
+
+	_, err = v.vaultClient.Logical().Write(secretPath+"/replication-token", map[string]interface{}{
+		"data": map[string]interface{}{"token": "root"},
+	})
+	require.NoError(t, err)
+
+	if v.enableEnterprise {
+		require.NotEmpty(t, v.enterpriseLicense, "VaultCluster.enterpriseLicense must be set when EnableEnterprise is true")
+		_, err = v.vaultClient.Logical().Write(secretPath+"/enterprise-license", map[string]interface{}{
+			"data": map[string]interface{}{"license": v.enterpriseLicense},
+		})
+		require.NoError(t, err)
+	}
+
+	err = v.vaultClient.Sys().Mount("pki", &vaultapi.MountInput{Type: "pki"})
+	require.NoError(t, err)
+	_, err = v.vaultClient.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"common_name": fmt.Sprintf("server.%s.consul", v.releaseName),
+		"ttl":         "87600h",
+	})
+	require.NoError(t, err)
+	_, err = v.vaultClient.Logical().Write("pki/roles/"+v.releaseName, map[string]interface{}{
+		"allow_any_name": true,
+		"max_ttl":        "720h",
+	})
+	require.NoError(t, err)
+
+	err = v.vaultClient.Sys().Mount("connect-ca", &vaultapi.MountInput{Type: "pki"})
+	require.NoError(t, err)
+	_, err = v.vaultClient.Logical().Write("connect-ca/root/generate/internal", map[string]interface{}{
+		"common_name": fmt.Sprintf("%s Connect CA", v.releaseName),
+		"ttl":         "87600h",
+	})
+	require.NoError(t, err)
+
+	// Consul generates and signs its own intermediate CSR against
+	// connect-ca the first time it starts, so connect-ca-intermediate
+	// starts out empty.
+	err = v.vaultClient.Sys().Mount("connect-ca-intermediate", &vaultapi.MountInput{Type: "pki"})
+	require.NoError(t, err)
+}
+
+// HelmValues returns the `global.secretsBackend.vault.*` Helm values that
+// point the Consul chart installation at this Vault cluster and the paths
+// the secrets were written to above.
+func (v *VaultCluster) HelmValues() map[string]string {
+	vaultAddr := fmt.Sprintf("http://%s-0.%s-headless:8200", v.vaultReleaseName, v.vaultReleaseName)
+
+	values := map[string]string{
+		"global.secretsBackend.vault.enabled":                               "true",
+		"global.secretsBackend.vault.consulServerRole":                      v.releaseName,
+		"global.secretsBackend.vault.consulClientRole":                      v.releaseName,
+		"global.secretsBackend.vault.consulCARole":                          v.releaseName,
+		"global.secretsBackend.vault.address":                               vaultAddr,
+		"global.secretsBackend.vault.agentAnnotations":                      "",
+		"global.secretsBackend.vault.consulServerTLS.serverCert.secretName": "pki/issue/" + v.releaseName,
+		"global.secretsBackend.vault.ca.secretName":                         "pki/cert/ca",
+		"global.secretsBackend.vault.connectCA.address":                     vaultAddr,
+		"global.secretsBackend.vault.connectCA.rootPKIPath":                 "connect-ca/",
+		"global.secretsBackend.vault.connectCA.intermediatePKIPath":         "connect-ca-intermediate/",
+		"global.gossipEncryption.secretName":                                fmt.Sprintf("secret/data/%s/gossip", v.releaseName),
+		"global.gossipEncryption.secretKey":                                 "key",
+		"global.acls.bootstrapToken.secretName":                             fmt.Sprintf("secret/data/%s/bootstrap-token", v.releaseName),
+		"global.acls.bootstrapToken.secretKey":                              "token",
+		"global.acls.replicationToken.secretName":                           fmt.Sprintf("secret/data/%s/replication-token", v.releaseName),
+		"global.acls.replicationToken.secretKey":                            "token",
+	}
+
+	if v.enableEnterprise {
+		values["server.enterpriseLicense.secretName"] = fmt.Sprintf("secret/data/%s/enterprise-license", v.releaseName)
+		values["server.enterpriseLicense.secretKey"] = "license"
+	}
+
+	return values
+}
+
+// BootstrapToken reads the Consul ACL bootstrap token back out of Vault. It
+// is used by SetupConsulClient when the Vault secrets backend is enabled.
+func (v *VaultCluster) BootstrapToken(t *testing.T) string {
+	t.Helper()
+
+	secret, err := v.vaultClient.Logical().Read(fmt.Sprintf("secret/data/%s/bootstrap-token", v.releaseName))
+	require.NoError(t, err)
+	require.NotNil(t, secret)
+
+	data, ok := secret.Data["data"].(map[string]interface{})
+	require.True(t, ok)
+
+	return data["token"].(string)
+}
@@ -0,0 +1,121 @@
+// Package environment provides the TestContext abstraction that decouples
+// acceptance tests from a single Kubernetes context, so that a test can
+// address several clusters (e.g. a primary and a secondary datacenter) by
+// holding one TestContext per cluster.
+package environment
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/k8s"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// TestContext describes a single Kubernetes cluster/context/namespace that
+// an acceptance test can install Consul into.
+type TestContext interface {
+	KubectlOptions(t *testing.T) *k8s.KubectlOptions
+	KubernetesClient(t *testing.T) kubernetes.Interface
+}
+
+// TestEnvironment vends the TestContext(s) a test suite was configured to
+// run against: a single context for most tests, or several for
+// federation/partition tests that need to drive more than one cluster.
+type TestEnvironment interface {
+	// DefaultContext returns the TestContext for the kubeconfig context the
+	// suite was invoked with.
+	DefaultContext(t *testing.T) TestContext
+	// Context returns the TestContext for the named kubeconfig context,
+	// creating and caching it on first use.
+	Context(t *testing.T, contextName string) TestContext
+}
+
+type kubernetesEnvironment struct {
+	kubeconfigPath string
+	defaultContext string
+	namespace      string
+
+	mu       sync.Mutex
+	contexts map[string]TestContext
+}
+
+// NewKubernetesEnvironment returns a TestEnvironment backed by contexts in
+// the kubeconfig at kubeconfigPath (empty means the default loading rules),
+// defaulting to defaultContext/namespace when DefaultContext is called.
+func NewKubernetesEnvironment(kubeconfigPath, defaultContext, namespace string) TestEnvironment {
+	return &kubernetesEnvironment{
+		kubeconfigPath: kubeconfigPath,
+		defaultContext: defaultContext,
+		namespace:      namespace,
+		contexts:       make(map[string]TestContext),
+	}
+}
+
+func (e *kubernetesEnvironment) DefaultContext(t *testing.T) TestContext {
+	t.Helper()
+	return e.Context(t, e.defaultContext)
+}
+
+func (e *kubernetesEnvironment) Context(t *testing.T, contextName string) TestContext {
+	t.Helper()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if ctx, ok := e.contexts[contextName]; ok {
+		return ctx
+	}
+
+	ctx := newKubernetesContext(t, e.kubeconfigPath, contextName, e.namespace)
+	e.contexts[contextName] = ctx
+	return ctx
+}
+
+// kubernetesContext is the default TestContext implementation, backed by a
+// kubeconfig file, a context name within it, and a namespace.
+type kubernetesContext struct {
+	kubectlOptions   *k8s.KubectlOptions
+	kubernetesClient kubernetes.Interface
+}
+
+func newKubernetesContext(t *testing.T, kubeconfig, contextName, namespace string) TestContext {
+	t.Helper()
+
+	opts := &k8s.KubectlOptions{
+		ContextName: contextName,
+		ConfigPath:  kubeconfig,
+		Namespace:   namespace,
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: contextName, Context: clientcmd.Context{Namespace: namespace}},
+	).ClientConfig()
+	require.NoError(t, err)
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	require.NoError(t, err)
+
+	return &kubernetesContext{
+		kubectlOptions:   opts,
+		kubernetesClient: client,
+	}
+}
+
+func (k *kubernetesContext) KubectlOptions(t *testing.T) *k8s.KubectlOptions {
+	t.Helper()
+	return k.kubectlOptions
+}
+
+func (k *kubernetesContext) KubernetesClient(t *testing.T) kubernetes.Interface {
+	t.Helper()
+	return k.kubernetesClient
+}
@@ -0,0 +1,67 @@
+// Package flags registers and parses the command-line flags that configure
+// an acceptance test run, and turns them into a config.TestConfig.
+package flags
+
+import (
+	"flag"
+
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+)
+
+// TestFlags holds the raw flag values for a test run, prior to being turned
+// into a config.TestConfig.
+type TestFlags struct {
+	flagKubeconfig  string
+	flagKubecontext string
+	flagNamespace   string
+
+	flagNoCleanupOnFailure bool
+	flagDebugDirectory     string
+	flagUseCLI             bool
+
+	flagEnableEnterprise  bool
+	flagEnterpriseLicense string
+
+	flagConsulImage    string
+	flagConsulK8SImage string
+}
+
+// NewTestFlags registers the acceptance test flags against the default
+// FlagSet and returns a TestFlags that ParseTestFlags can later read from.
+func NewTestFlags() *TestFlags {
+	t := &TestFlags{}
+
+	flag.StringVar(&t.flagKubeconfig, "kubeconfig", "", "The path to a kubeconfig file. If not provided, defaults to the current context.")
+	flag.StringVar(&t.flagKubecontext, "kube-context", "", "The name of the kubectl context to use, if not the kubeconfig's current context.")
+	flag.StringVar(&t.flagNamespace, "namespace", "default", "The Kubernetes namespace to install into.")
+
+	flag.BoolVar(&t.flagNoCleanupOnFailure, "no-cleanup-on-failure", false,
+		"If true, the tests will not cleanup Kubernetes resources they create when they finish running.")
+	flag.StringVar(&t.flagDebugDirectory, "debug-directory", "", "The directory where test debug information is written.")
+	flag.BoolVar(&t.flagUseCLI, "use-cli", false, "If true, tests will install Consul using the consul-k8s CLI instead of Helm.")
+
+	flag.BoolVar(&t.flagEnableEnterprise, "enable-enterprise", false, "If true, the test suite will run tests for enterprise features.")
+	flag.StringVar(&t.flagEnterpriseLicense, "enterprise-license", "", "The enterprise license for Consul.")
+
+	flag.StringVar(&t.flagConsulImage, "consul-image", "", "The Consul image to use for all tests.")
+	flag.StringVar(&t.flagConsulK8SImage, "consul-k8s-image", "", "The consul-k8s image to use for all tests.")
+
+	return t
+}
+
+// TestConfigFromFlags returns a config.TestConfig populated from the parsed
+// flag values. flag.Parse() must have been called before this is called.
+func (t *TestFlags) TestConfigFromFlags() *config.TestConfig {
+	return &config.TestConfig{
+		KubeconfigPath:     t.flagKubeconfig,
+		KubeContext:        t.flagKubecontext,
+		Namespace:          t.flagNamespace,
+		NoCleanupOnFailure: t.flagNoCleanupOnFailure,
+		DebugDirectory:     t.flagDebugDirectory,
+		UseCLI:             t.flagUseCLI,
+		EnableEnterprise:   t.flagEnableEnterprise,
+		EnterpriseLicense:  t.flagEnterpriseLicense,
+		ConsulImage:        t.flagConsulImage,
+		ConsulK8SImage:     t.flagConsulK8SImage,
+	}
+}
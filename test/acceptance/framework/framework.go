@@ -0,0 +1,40 @@
+// Package framework is a thin re-export of the framework/{config,
+// environment, consul} subpackages, kept around so
+// that acceptance tests can continue to refer to framework.HelmCluster,
+// framework.TestConfig, etc. without importing half a dozen subpackages by
+// hand. Prefer importing the subpackages directly in new code.
+package framework
+
+import (
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/consul"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+)
+
+type (
+	TestConfig      = config.TestConfig
+	TestContext     = environment.TestContext
+	TestEnvironment = environment.TestEnvironment
+
+	Cluster            = consul.Cluster
+	ConsulClientOption = consul.ConsulClientOption
+	CleanupPolicy      = consul.CleanupPolicy
+	HelmCluster        = consul.HelmCluster
+	CLICluster         = consul.CLICluster
+	VaultCluster       = consul.VaultCluster
+)
+
+var (
+	NewCluster                = consul.NewCluster
+	NewHelmCluster            = consul.NewHelmCluster
+	NewHelmClusterInPartition = consul.NewHelmClusterInPartition
+	NewCLICluster             = consul.NewCLICluster
+	NewVaultCluster           = consul.NewVaultCluster
+	WithServerPod             = consul.WithServerPod
+	CopyCACertAndKey          = consul.CopyCACertAndKey
+	ApplyFederationSecret     = consul.ApplyFederationSecret
+	CopyPartitionSecrets      = consul.CopyPartitionSecrets
+	LabelCleanupPolicy        = consul.LabelCleanupPolicy
+	NameCleanupPolicy         = consul.NameCleanupPolicy
+	CustomCleanupPolicy       = consul.CustomCleanupPolicy
+)
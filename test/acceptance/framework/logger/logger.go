@@ -0,0 +1,76 @@
+// Package logger provides a terratest-compatible logger that prefixes every
+// line with an RFC3339 timestamp and the current test's name, and tees the
+// output to a per-test log file under a debug directory in addition to
+// stdout. Long-running, multi-cluster tests (federation, partitions) are
+// otherwise very hard to debug from interleaved stdout alone.
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	terratestlogger "github.com/gruntwork-io/terratest/modules/logger"
+)
+
+// New returns a terratest logger.Logger that writes timestamped,
+// test-prefixed lines to stdout, and additionally to
+// "<debugDirectory>/<test-name>.log" when debugDirectory is non-empty.
+func New(debugDirectory string) *terratestlogger.Logger {
+	return terratestlogger.New(&testLogger{debugDirectory: debugDirectory})
+}
+
+type testLogger struct {
+	debugDirectory string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+func (l *testLogger) Logf(t terratestlogger.TestingT, format string, args ...interface{}) {
+	line := fmt.Sprintf("%s [%s] %s", time.Now().Format(time.RFC3339), t.Name(), fmt.Sprintf(format, args...))
+
+	fmt.Println(line)
+
+	if l.debugDirectory == "" {
+		return
+	}
+
+	f, err := l.logFile(t.Name())
+	if err != nil {
+		fmt.Printf("logger: could not open debug log file for %s: %s\n", t.Name(), err)
+		return
+	}
+	fmt.Fprintln(f, line)
+}
+
+// logFile returns (opening and caching, if necessary) the log file for the
+// given test name.
+func (l *testLogger) logFile(testName string) (*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.files == nil {
+		l.files = make(map[string]*os.File)
+	}
+	if f, ok := l.files[testName]; ok {
+		return f, nil
+	}
+
+	// testName may be a subtest name like "TestFoo/case_1", which makes
+	// logPath nested below debugDirectory, so create its full parent
+	// directory rather than just debugDirectory itself.
+	logPath := filepath.Join(l.debugDirectory, testName+".log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	l.files[testName] = f
+	return f, nil
+}
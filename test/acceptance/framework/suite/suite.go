@@ -0,0 +1,54 @@
+// Package suite ties together flag parsing and environment setup for an
+// acceptance test binary's TestMain, so that individual test files don't
+// each have to know how to build a config.TestConfig and environment.TestEnvironment.
+package suite
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/config"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/environment"
+	"github.com/hashicorp/consul-helm/test/acceptance/framework/flags"
+)
+
+// Suite holds the configuration and default environment a test binary was
+// invoked with.
+type Suite struct {
+	config      *config.TestConfig
+	environment environment.TestEnvironment
+	m           *testing.M
+}
+
+// NewSuite registers and parses the acceptance test flags, and returns a
+// Suite wrapping the resulting config.TestConfig and environment.TestEnvironment.
+// Call this from TestMain before m.Run().
+func NewSuite(m *testing.M) *Suite {
+	testFlags := flags.NewTestFlags()
+	flag.Parse()
+
+	cfg := testFlags.TestConfigFromFlags()
+
+	return &Suite{
+		config:      cfg,
+		environment: environment.NewKubernetesEnvironment(cfg.KubeconfigPath, cfg.KubeContext, cfg.Namespace),
+		m:           m,
+	}
+}
+
+// Config returns the config.TestConfig this test binary was invoked with.
+func (s *Suite) Config() *config.TestConfig {
+	return s.config
+}
+
+// Environment returns the environment.TestEnvironment this test binary was
+// invoked with. Call DefaultContext or Context on it from within a test to
+// get a TestContext.
+func (s *Suite) Environment() environment.TestEnvironment {
+	return s.environment
+}
+
+// Run executes the test binary's tests and returns the process exit code.
+func (s *Suite) Run() int {
+	return s.m.Run()
+}
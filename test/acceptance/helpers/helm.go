@@ -0,0 +1,38 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/helm"
+	"github.com/stretchr/testify/require"
+)
+
+// MergeMaps will merge the values in b with values in a and save in a.
+// If there are conflicts, the values in b will overwrite the values in a.
+func MergeMaps(a, b map[string]string) {
+	for k, v := range b {
+		a[k] = v
+	}
+}
+
+// CheckForPriorInstallations checks if there is an existing Helm release of
+// the Consul chart already installed against helmOptions. If there is, it
+// fails the tests. It's shared between HelmCluster and CLICluster so both
+// install paths refuse to stomp on an existing installation.
+func CheckForPriorInstallations(t *testing.T, helmOptions *helm.Options) {
+	t.Helper()
+
+	output, err := helm.RunHelmCommandAndGetOutputE(t, helmOptions, "list", "--output", "json")
+	require.NoError(t, err)
+
+	var installedReleases []map[string]string
+
+	err = json.Unmarshal([]byte(output), &installedReleases)
+	require.NoError(t, err)
+
+	for _, r := range installedReleases {
+		require.NotContains(t, r["chart"], "consul", fmt.Sprintf("detected an existing installation of Consul %s, release name: %s", r["chart"], r["name"]))
+	}
+}